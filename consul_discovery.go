@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+// ConsulDiscovery backs Discovery with Consul, giving each worker its own
+// TTL session for its registration (so Consul expires a dead worker's key on
+// its own, independent of every other worker) and plain KV puts for task
+// claims.
+type ConsulDiscovery struct {
+	client *consul.Client
+
+	mu       sync.Mutex
+	sessions map[string]string // worker address -> its own session ID
+}
+
+// NewConsulDiscovery creates a Consul client against address. Sessions are
+// created per-worker on demand in RegisterWorker, not here.
+func NewConsulDiscovery(address string) (*ConsulDiscovery, error) {
+	client, err := consul.NewClient(&consul.Config{Address: address})
+	if err != nil {
+		return nil, fmt.Errorf("NewConsulDiscovery: client: %v", err)
+	}
+
+	return &ConsulDiscovery{client: client, sessions: make(map[string]string)}, nil
+}
+
+// RegisterWorker (re)advertises address under its own session, creating one
+// on first sight of address and renewing it on every subsequent call. A
+// worker that stops calling RegisterWorker - because it crashed - simply
+// stops renewing its session, and SessionBehaviorDelete expires that
+// worker's key on its own after workerLeaseTTL without touching any other
+// worker's session, so a busy cluster where only some workers poll in a
+// given tick can never wipe every worker's registration at once.
+func (d *ConsulDiscovery) RegisterWorker(address string) error {
+	d.mu.Lock()
+	sessionID, ok := d.sessions[address]
+	d.mu.Unlock()
+
+	if ok {
+		if _, _, err := d.client.Session().Renew(sessionID, nil); err == nil {
+			_, err := d.client.KV().Put(&consul.KVPair{
+				Key:     workerKey(address),
+				Value:   []byte(address),
+				Session: sessionID,
+			}, nil)
+			return err
+		}
+		// The session likely already expired; fall through and create a fresh one.
+	}
+
+	session, _, err := d.client.Session().Create(&consul.SessionEntry{
+		TTL:      workerLeaseTTL.String(),
+		Behavior: consul.SessionBehaviorDelete,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("RegisterWorker: creating session for %s: %v", address, err)
+	}
+
+	d.mu.Lock()
+	d.sessions[address] = session
+	d.mu.Unlock()
+
+	_, err = d.client.KV().Put(&consul.KVPair{
+		Key:     workerKey(address),
+		Value:   []byte(address),
+		Session: session,
+	}, nil)
+	return err
+}
+
+func (d *ConsulDiscovery) Workers() ([]string, error) {
+	pairs, _, err := d.client.KV().List("mapreduce/workers/", nil)
+	if err != nil {
+		return nil, err
+	}
+	var addresses []string
+	for _, pair := range pairs {
+		addresses = append(addresses, string(pair.Value))
+	}
+	return addresses, nil
+}
+
+func (d *ConsulDiscovery) ClaimTask(kind TaskType, n int, worker string) error {
+	_, err := d.client.KV().Put(&consul.KVPair{
+		Key:   taskKey(kind, n),
+		Value: []byte(worker),
+	}, nil)
+	return err
+}
+
+func (d *ConsulDiscovery) ReleaseTask(kind TaskType, n int) error {
+	_, err := d.client.KV().Delete(taskKey(kind, n), nil)
+	return err
+}
+
+func (d *ConsulDiscovery) TaskOwner(kind TaskType, n int) (string, bool, error) {
+	pair, _, err := d.client.KV().Get(taskKey(kind, n), nil)
+	if err != nil {
+		return "", false, err
+	}
+	if pair == nil {
+		return "", false, nil
+	}
+	return string(pair.Value), true, nil
+}
+
+func (d *ConsulDiscovery) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var firstErr error
+	for _, sessionID := range d.sessions {
+		if _, err := d.client.Session().Destroy(sessionID, nil); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
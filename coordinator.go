@@ -0,0 +1,378 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// taskTimeout is how long the coordinator waits for a TaskDone RPC before
+// assuming the worker it handed the task to has died and re-enqueuing the
+// task for someone else.
+const taskTimeout = 10 * time.Second
+
+// inFlightTask remembers when a task was handed out so the coordinator can
+// tell a slow worker apart from a dead one.
+type inFlightTask struct {
+	startedAt time.Time
+}
+
+// Coordinator owns the master queue of map and reduce tasks and hands them
+// out to workers one at a time over RPC. It never runs a task itself.
+type Coordinator struct {
+	mu sync.Mutex
+
+	tmpdir    string
+	address   string // where this coordinator's /data/ server can be reached
+	discovery Discovery
+	progress  *Progress
+	m, r      int
+
+	mapQueue    []int // map task numbers not yet claimed
+	reduceQueue []int // reduce task numbers not yet claimed
+
+	inFlightMap    map[int]inFlightTask
+	inFlightReduce map[int]inFlightTask
+
+	mapDone    int
+	reduceDone int
+
+	// mapSourceHosts[n] is where map worker n can be reached once it has
+	// finished, so later reduce tasks know where to fetch its output from.
+	mapSourceHosts []string
+
+	// reduceSourceHosts[n] is where reduce worker n can be reached once it
+	// has finished, so GatherOutputs knows where to fetch reduce_N_output.db
+	// from once the whole job is done.
+	reduceSourceHosts []string
+}
+
+// NewCoordinator builds a coordinator for an m-map/r-reduce job whose map
+// inputs live in tmpdir. discovery is the worker-membership and task-claim
+// backend to use; pass NewLocalDiscovery() for the single-process default.
+func NewCoordinator(tmpdir string, m, r int, discovery Discovery) *Coordinator {
+	c := &Coordinator{
+		tmpdir:            tmpdir,
+		m:                 m,
+		r:                 r,
+		discovery:         discovery,
+		progress:          NewProgress(m, r),
+		inFlightMap:       make(map[int]inFlightTask),
+		inFlightReduce:    make(map[int]inFlightTask),
+		mapSourceHosts:    make([]string, m),
+		reduceSourceHosts: make([]string, r),
+	}
+	for i := 0; i < m; i++ {
+		c.mapQueue = append(c.mapQueue, i)
+	}
+	for i := 0; i < r; i++ {
+		c.reduceQueue = append(c.reduceQueue, i)
+	}
+	return c
+}
+
+// Heartbeat is called by a worker while it's in the middle of a task, so a
+// task that legitimately runs longer than workerLeaseTTL doesn't make the
+// worker look dead to checkTimeouts' liveness cross-check. It only touches
+// discovery, not any task state - RequestTask is still the only way a
+// worker gets or finishes a task.
+func (c *Coordinator) Heartbeat(args *HeartbeatArgs, reply *HeartbeatReply) error {
+	if err := c.discovery.RegisterWorker(args.WorkerAddress); err != nil {
+		log.Printf("coordinator: Heartbeat: RegisterWorker(%s): %v", args.WorkerAddress, err)
+	}
+	return nil
+}
+
+// RequestTask is called by a worker that wants something to do.
+func (c *Coordinator) RequestTask(args *TaskArgs, reply *TaskReply) error {
+	if err := c.discovery.RegisterWorker(args.WorkerAddress); err != nil {
+		log.Printf("coordinator: RegisterWorker(%s): %v", args.WorkerAddress, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reply.TmpDir = c.tmpdir
+
+	if len(c.mapQueue) > 0 {
+		n := c.mapQueue[0]
+		c.mapQueue = c.mapQueue[1:]
+		c.inFlightMap[n] = inFlightTask{startedAt: time.Now()}
+		if err := c.discovery.ClaimTask(TaskMap, n, args.WorkerAddress); err != nil {
+			log.Printf("coordinator: ClaimTask(map %d): %v", n, err)
+		}
+		c.progress.TaskStarted(TaskMap)
+		reply.Type = TaskMap
+		reply.MapTask = &MapTask{M: c.m, R: c.r, N: n, SourceHost: c.address}
+		return nil
+	}
+
+	if c.mapDone < c.m {
+		// every map task is either in flight or done but we're not done yet:
+		// reduce can't start until all map output exists.
+		reply.Type = TaskWait
+		return nil
+	}
+
+	if len(c.reduceQueue) > 0 {
+		n := c.reduceQueue[0]
+		c.reduceQueue = c.reduceQueue[1:]
+		c.inFlightReduce[n] = inFlightTask{startedAt: time.Now()}
+		if err := c.discovery.ClaimTask(TaskReduce, n, args.WorkerAddress); err != nil {
+			log.Printf("coordinator: ClaimTask(reduce %d): %v", n, err)
+		}
+		c.progress.TaskStarted(TaskReduce)
+		// SourceHosts is populated from mapSourceHosts as each map task's
+		// TaskDone arrives, so a map task that got reassigned mid-job still
+		// points reducers at whichever worker actually holds its output. A
+		// host whose lease has since expired can't be recovered here (its
+		// map output is gone, not just its claim), but it's worth a loud log
+		// rather than silently handing the reducer a fetch that's sure to
+		// fail.
+		hosts := make([]string, c.m)
+		copy(hosts, c.mapSourceHosts)
+		if live, err := c.discovery.Workers(); err == nil {
+			liveSet := make(map[string]bool, len(live))
+			for _, address := range live {
+				liveSet[address] = true
+			}
+			for i, host := range hosts {
+				if host != "" && !liveSet[host] {
+					log.Printf("coordinator: map task %d's output host %s is no longer live", i, host)
+				}
+			}
+		}
+		reply.Type = TaskReduce
+		reply.ReduceTask = &ReduceTask{M: c.m, R: c.r, N: n, SourceHosts: hosts}
+		return nil
+	}
+
+	if c.reduceDone < c.r {
+		reply.Type = TaskWait
+		return nil
+	}
+
+	reply.Type = TaskExit
+	return nil
+}
+
+// TaskDone is called by a worker that finished the task it was handed.
+func (c *Coordinator) TaskDone(args *TaskDoneArgs, reply *TaskDoneReply) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch args.Type {
+	case TaskMap:
+		if _, ok := c.inFlightMap[args.N]; !ok {
+			// already reassigned and finished by someone else; ignore.
+			return nil
+		}
+		delete(c.inFlightMap, args.N)
+		c.mapSourceHosts[args.N] = args.WorkerAddress
+		c.mapDone++
+	case TaskReduce:
+		if _, ok := c.inFlightReduce[args.N]; !ok {
+			return nil
+		}
+		delete(c.inFlightReduce, args.N)
+		c.reduceSourceHosts[args.N] = args.WorkerAddress
+		c.reduceDone++
+	}
+	c.progress.TaskFinished(args.Type, args.PairsIn, args.PairsOut, args.BytesOut, args.ElapsedMs)
+	if err := c.discovery.ReleaseTask(args.Type, args.N); err != nil {
+		log.Printf("coordinator: ReleaseTask(%v %d): %v", args.Type, args.N, err)
+	}
+	return nil
+}
+
+// Done reports whether every map and reduce task has finished.
+func (c *Coordinator) Done() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mapDone == c.m && c.reduceDone == c.r
+}
+
+// ReduceHosts returns where each reduce task's output can be fetched from,
+// once Done reports true.
+func (c *Coordinator) ReduceHosts() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hosts := make([]string, len(c.reduceSourceHosts))
+	copy(hosts, c.reduceSourceHosts)
+	return hosts
+}
+
+// checkTimeouts re-enqueues any in-flight task that has been out longer than
+// taskTimeout, on the assumption that the worker holding it has crashed. It
+// confirms that assumption against the discovery backend first: if the
+// worker that claimed the task is still renewing its lease (present in
+// Workers()) and still recorded as the task's owner (TaskOwner), it's more
+// likely just slow than dead, so it keeps the task rather than having it
+// stolen out from under it by a spurious in-memory timeout.
+func (c *Coordinator) checkTimeouts() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	live, err := c.discovery.Workers()
+	if err != nil {
+		log.Printf("coordinator: Workers(): %v", err)
+	}
+	liveSet := make(map[string]bool, len(live))
+	for _, address := range live {
+		liveSet[address] = true
+	}
+
+	now := time.Now()
+	for n, t := range c.inFlightMap {
+		if now.Sub(t.startedAt) <= taskTimeout {
+			continue
+		}
+		if owner, ok, err := c.discovery.TaskOwner(TaskMap, n); err == nil && ok && liveSet[owner] {
+			continue
+		}
+		log.Printf("coordinator: map task %d timed out, re-enqueuing", n)
+		delete(c.inFlightMap, n)
+		c.mapQueue = append(c.mapQueue, n)
+		c.progress.TaskFailed(TaskMap)
+		if err := c.discovery.ReleaseTask(TaskMap, n); err != nil {
+			log.Printf("coordinator: ReleaseTask(map %d): %v", n, err)
+		}
+	}
+	for n, t := range c.inFlightReduce {
+		if now.Sub(t.startedAt) <= taskTimeout {
+			continue
+		}
+		if owner, ok, err := c.discovery.TaskOwner(TaskReduce, n); err == nil && ok && liveSet[owner] {
+			continue
+		}
+		log.Printf("coordinator: reduce task %d timed out, re-enqueuing", n)
+		delete(c.inFlightReduce, n)
+		c.reduceQueue = append(c.reduceQueue, n)
+		c.progress.TaskFailed(TaskReduce)
+		if err := c.discovery.ReleaseTask(TaskReduce, n); err != nil {
+			log.Printf("coordinator: ReleaseTask(reduce %d): %v", n, err)
+		}
+	}
+}
+
+// watchTimeouts runs checkTimeouts on a ticker until the job is done.
+func (c *Coordinator) watchTimeouts() {
+	ticker := time.NewTicker(taskTimeout / 2)
+	defer ticker.Stop()
+	for !c.Done() {
+		<-ticker.C
+		c.checkTimeouts()
+	}
+}
+
+// Serve registers the coordinator for RPC, starts the /data/ file server
+// used to hand out map source files, and blocks until the job is done.
+func (c *Coordinator) Serve(address string) error {
+	c.address = address
+
+	if err := rpc.Register(c); err != nil {
+		return err
+	}
+	rpc.HandleHTTP()
+
+	http.Handle("/data/", http.StripPrefix("/data", http.FileServer(http.Dir(c.tmpdir))))
+	c.progress.ServeStatus()
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	go http.Serve(listener, nil)
+
+	go c.watchTimeouts()
+
+	done := make(chan struct{})
+	go c.progress.RunBar(done)
+
+	for !c.Done() {
+		time.Sleep(time.Second)
+	}
+	close(done)
+	return nil
+}
+
+// newDiscovery builds the Discovery backend named by kind. endpoint is a
+// comma-separated list of etcd endpoints for "etcd", or a single host:port
+// for "consul"; it's ignored for "local".
+func newDiscovery(kind, endpoint string) (Discovery, error) {
+	switch kind {
+	case "", "local":
+		return NewLocalDiscovery(), nil
+	case "etcd":
+		return NewEtcdDiscovery(strings.Split(endpoint, ","))
+	case "consul":
+		return NewConsulDiscovery(endpoint)
+	default:
+		return nil, fmt.Errorf("unknown discovery backend %q (want local, etcd, or consul)", kind)
+	}
+}
+
+// runCoordinatorMain splits source into m map input files, starts a
+// coordinator listening on :8080, and blocks until every map and reduce
+// task has been completed by some worker. backendKind/backendEndpoint pick
+// the Discovery implementation; see newDiscovery.
+func runCoordinatorMain(source, backendKind, backendEndpoint string) {
+	number_of_rows, err := getNumberOfRows(source)
+	if err != nil {
+		log.Fatalf("counting rows in %s: %v", source, err)
+	}
+	page_count, _, err := getDatabaseSize(source)
+	if err != nil {
+		log.Fatalf("sizing %s: %v", source, err)
+	}
+
+	var m int = number_of_rows / page_count
+	var r int = m / 2
+	if r < 1 {
+		r = 1
+	}
+
+	tempdir := filepath.Join(os.TempDir(), fmt.Sprintf("mapreduce.%d", os.Getpid()))
+	if err := os.RemoveAll(tempdir); err != nil {
+		log.Fatalf("unable to delete old temp dir: %v", err)
+	}
+	if err := os.Mkdir(tempdir, 0700); err != nil {
+		log.Fatalf("unable to make a temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	log.Printf("splitting %s into %d pieces", source, m)
+
+	paths := createPaths(m, mapSource, tempdir)
+	if err := splitDatabase(source, paths); err != nil {
+		log.Fatalf("splitting database: %v", err)
+	}
+
+	the_address := net.JoinHostPort(getLocalAddress(), "8080")
+	log.Printf("coordinator listening on %s for %d map / %d reduce tasks", the_address, m, r)
+
+	discovery, err := newDiscovery(backendKind, backendEndpoint)
+	if err != nil {
+		log.Fatalf("coordinator: %v", err)
+	}
+	defer discovery.Close()
+
+	c := NewCoordinator(tempdir, m, r, discovery)
+	if err := c.Serve(the_address); err != nil {
+		log.Fatalf("coordinator: %v", err)
+	}
+
+	log.Print("all map and reduce tasks done, gathering output into target.db")
+	if err := GatherOutputs(c.ReduceHosts(), "target.db"); err != nil {
+		log.Fatalf("gathering outputs: %v", err)
+	}
+
+	log.Print("job done")
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// pairsSchema is the table every stage of the pipeline reads and writes:
+// map input/output, reduce input/output, and the final gathered target.db
+// are all just a "pairs" table of (key, value) rows.
+const pairsSchema = `CREATE TABLE IF NOT EXISTS pairs (key TEXT, value TEXT)`
+
+// createDatabase creates a fresh sqlite database at path with the pairs
+// table, removing anything already at path first. Callers rely on this to
+// make a retried attempt (same task, same tmpdir) start from an empty table
+// instead of appending onto whatever an earlier, abandoned attempt wrote.
+func createDatabase(path string) (*sql.DB, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("createDatabase: removing stale %s: %v", path, err)
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("createDatabase: opening %s: %v", path, err)
+	}
+	if _, err := db.Exec(pairsSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("createDatabase: creating pairs table in %s: %v", path, err)
+	}
+	return db, nil
+}
+
+// openDatabase opens an existing sqlite database at path.
+func openDatabase(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("openDatabase: opening %s: %v", path, err)
+	}
+	return db, nil
+}
+
+// download HTTP-GETs url and writes the response body to path.
+func download(url, path string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return fmt.Errorf("download: GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download: GET %s: status %s", url, resp.Status)
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("download: creating %s: %v", path, err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return fmt.Errorf("download: writing %s: %v", path, err)
+	}
+	return nil
+}
+
+// getNumberOfRows returns how many rows are in path's pairs table, used by
+// runCoordinatorMain to size the job.
+func getNumberOfRows(path string) (int, error) {
+	db, err := openDatabase(path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow("select count(*) from pairs").Scan(&count); err != nil {
+		return 0, fmt.Errorf("getNumberOfRows: %v", err)
+	}
+	return count, nil
+}
+
+// getDatabaseSize returns path's sqlite page count and page size, which
+// runCoordinatorMain uses as a rough proxy for how many map tasks to split
+// the job into.
+func getDatabaseSize(path string) (int, int, error) {
+	db, err := openDatabase(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer db.Close()
+
+	var pageCount, pageSize int
+	if err := db.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, 0, fmt.Errorf("getDatabaseSize: page_count: %v", err)
+	}
+	if err := db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, 0, fmt.Errorf("getDatabaseSize: page_size: %v", err)
+	}
+	return pageCount, pageSize, nil
+}
+
+// splitDatabase divides source's pairs rows round-robin across len(paths)
+// new databases, so each map task gets roughly the same amount of input.
+func splitDatabase(source string, paths []string) error {
+	in, err := openDatabase(source)
+	if err != nil {
+		return fmt.Errorf("splitDatabase: opening %s: %v", source, err)
+	}
+	defer in.Close()
+
+	if len(paths) == 0 {
+		return fmt.Errorf("splitDatabase: no output paths given")
+	}
+
+	rows, err := in.Query("select key, value from pairs")
+	if err != nil {
+		return fmt.Errorf("splitDatabase: querying %s: %v", source, err)
+	}
+	defer rows.Close()
+
+	outs := make([]*sql.DB, len(paths))
+	stmts := make([]*sql.Stmt, len(paths))
+	txs := make([]*sql.Tx, len(paths))
+	rollback := func() {
+		for i, tx := range txs {
+			if tx != nil {
+				tx.Rollback()
+			}
+			if outs[i] != nil {
+				outs[i].Close()
+			}
+		}
+	}
+
+	for i, path := range paths {
+		out, err := createDatabase(path)
+		if err != nil {
+			rollback()
+			return err
+		}
+		outs[i] = out
+
+		tx, err := out.Begin()
+		if err != nil {
+			rollback()
+			return fmt.Errorf("splitDatabase: begin %s: %v", path, err)
+		}
+		txs[i] = tx
+
+		stmt, err := tx.Prepare("INSERT INTO pairs (key, value) VALUES (?, ?)")
+		if err != nil {
+			rollback()
+			return fmt.Errorf("splitDatabase: prepare %s: %v", path, err)
+		}
+		stmts[i] = stmt
+	}
+
+	i := 0
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			rollback()
+			return fmt.Errorf("splitDatabase: scanning row: %v", err)
+		}
+		if _, err := stmts[i%len(paths)].Exec(key, value); err != nil {
+			rollback()
+			return fmt.Errorf("splitDatabase: inserting row: %v", err)
+		}
+		i++
+	}
+	if err := rows.Err(); err != nil {
+		rollback()
+		return err
+	}
+
+	for i, stmt := range stmts {
+		stmt.Close()
+		if err := txs[i].Commit(); err != nil {
+			outs[i].Close()
+			return fmt.Errorf("splitDatabase: commit %s: %v", paths[i], err)
+		}
+		outs[i].Close()
+	}
+	return nil
+}
+
+// mergeDatabases downloads each of urls (one map task's output shard for
+// this reduce partition) alongside tempPath and combines them into a single
+// pairs database at inputPath, which it returns open for the caller to
+// query.
+func mergeDatabases(urls []string, inputPath, tempPath string) (*sql.DB, error) {
+	out, err := createDatabase(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("mergeDatabases: creating %s: %v", inputPath, err)
+	}
+
+	tx, err := out.Begin()
+	if err != nil {
+		out.Close()
+		return nil, fmt.Errorf("mergeDatabases: begin %s: %v", inputPath, err)
+	}
+	stmt, err := tx.Prepare("INSERT INTO pairs (key, value) VALUES (?, ?)")
+	if err != nil {
+		tx.Rollback()
+		out.Close()
+		return nil, fmt.Errorf("mergeDatabases: prepare %s: %v", inputPath, err)
+	}
+
+	for i, url := range urls {
+		shardPath := fmt.Sprintf("%s.%d", tempPath, i)
+		if err := download(url, shardPath); err != nil {
+			stmt.Close()
+			tx.Rollback()
+			out.Close()
+			return nil, fmt.Errorf("mergeDatabases: downloading %s: %v", url, err)
+		}
+		defer os.Remove(shardPath)
+
+		if err := mergeOneShard(stmt, shardPath); err != nil {
+			stmt.Close()
+			tx.Rollback()
+			out.Close()
+			return nil, fmt.Errorf("mergeDatabases: merging %s: %v", shardPath, err)
+		}
+	}
+
+	stmt.Close()
+	if err := tx.Commit(); err != nil {
+		out.Close()
+		return nil, fmt.Errorf("mergeDatabases: commit %s: %v", inputPath, err)
+	}
+	return out, nil
+}
+
+// mergeOneShard copies every row of shardPath's pairs table through stmt.
+func mergeOneShard(stmt *sql.Stmt, shardPath string) error {
+	shard, err := openDatabase(shardPath)
+	if err != nil {
+		return err
+	}
+	defer shard.Close()
+
+	rows, err := shard.Query("select key, value from pairs")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(key, value); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// workerLeaseTTL is how long a worker registration is valid for before it's
+// considered dead and reassigned, mirroring taskTimeout's role for tasks.
+const workerLeaseTTL = 15 * time.Second
+
+func workerKey(address string) string {
+	return fmt.Sprintf("mapreduce/workers/%s", address)
+}
+
+func taskKey(kind TaskType, n int) string {
+	part := "map"
+	if kind == TaskReduce {
+		part = "reduce"
+	}
+	return fmt.Sprintf("mapreduce/tasks/%s/%d", part, n)
+}
+
+// Discovery is the pluggable backend behind worker membership and task
+// ownership. LocalDiscovery keeps everything in the coordinator's own
+// memory, which is all a single coordinator process needs. EtcdDiscovery and
+// ConsulDiscovery back the same operations with a real KV store instead, so
+// worker liveness and task claims are visible outside this one process.
+//
+// The coordinator's own job state (mapQueue, inFlightMap, mapDone, and so
+// on) still lives only in Coordinator's memory, not in Discovery, so this
+// does not by itself let a second coordinator replica take over a job after
+// the first one crashes. What the etcd/consul backends buy today is a
+// liveness signal checkTimeouts can cross-check before reassigning a task
+// that's merely slow, not a substitute for the coordinator's in-memory
+// state.
+type Discovery interface {
+	// RegisterWorker (re)advertises address as alive under
+	// workerKey(address) with workerLeaseTTL, refreshing the lease each call.
+	RegisterWorker(address string) error
+	// Workers returns every worker address whose lease hasn't expired.
+	Workers() ([]string, error)
+	// ClaimTask records that worker owns task kind/n under taskKey(kind, n).
+	ClaimTask(kind TaskType, n int, worker string) error
+	// ReleaseTask clears a claim, e.g. once the task is done or reassigned.
+	ReleaseTask(kind TaskType, n int) error
+	// TaskOwner returns who currently owns a task, if anyone.
+	TaskOwner(kind TaskType, n int) (worker string, ok bool, err error)
+	Close() error
+}
+
+// LocalDiscovery is an in-memory Discovery backend: today's behavior, where
+// the coordinator is the only source of truth and nothing survives its
+// process exiting.
+type LocalDiscovery struct {
+	mu sync.Mutex
+
+	workers map[string]time.Time // address -> lease expiry
+	claims  map[string]string    // taskKey -> worker address
+}
+
+func NewLocalDiscovery() *LocalDiscovery {
+	return &LocalDiscovery{
+		workers: make(map[string]time.Time),
+		claims:  make(map[string]string),
+	}
+}
+
+func (d *LocalDiscovery) RegisterWorker(address string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.workers[address] = time.Now().Add(workerLeaseTTL)
+	return nil
+}
+
+func (d *LocalDiscovery) Workers() ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	var live []string
+	for address, expiry := range d.workers {
+		if now.Before(expiry) {
+			live = append(live, address)
+		} else {
+			delete(d.workers, address)
+		}
+	}
+	return live, nil
+}
+
+func (d *LocalDiscovery) ClaimTask(kind TaskType, n int, worker string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.claims[taskKey(kind, n)] = worker
+	return nil
+}
+
+func (d *LocalDiscovery) ReleaseTask(kind TaskType, n int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.claims, taskKey(kind, n))
+	return nil
+}
+
+func (d *LocalDiscovery) TaskOwner(kind TaskType, n int) (string, bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	worker, ok := d.claims[taskKey(kind, n)]
+	return worker, ok, nil
+}
+
+func (d *LocalDiscovery) Close() error {
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// EtcdDiscovery backs Discovery with etcd, giving each worker its own lease
+// on its key so a crashed worker's registration disappears on its own once
+// that worker stops renewing it, independent of every other worker and of
+// how long this coordinator process itself runs. Task claims are plain KV
+// puts, so ownership is visible outside this one coordinator process.
+type EtcdDiscovery struct {
+	client *clientv3.Client
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	leases map[string]clientv3.LeaseID // worker address -> its own lease
+}
+
+// NewEtcdDiscovery dials the given etcd endpoints. Leases are granted
+// per-worker on demand in RegisterWorker, not here.
+func NewEtcdDiscovery(endpoints []string) (*EtcdDiscovery, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("NewEtcdDiscovery: dial: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &EtcdDiscovery{client: client, ctx: ctx, cancel: cancel, leases: make(map[string]clientv3.LeaseID)}, nil
+}
+
+// RegisterWorker (re)advertises address under its own lease, granting one on
+// first sight of address and renewing it (via KeepAliveOnce, not a
+// continuous stream) on every subsequent call. A worker that stops calling
+// RegisterWorker - because it crashed - simply stops renewing its lease,
+// and etcd expires that worker's key on its own after workerLeaseTTL without
+// touching any other worker's registration.
+func (d *EtcdDiscovery) RegisterWorker(address string) error {
+	d.mu.Lock()
+	leaseID, ok := d.leases[address]
+	d.mu.Unlock()
+
+	if ok {
+		if _, err := d.client.KeepAliveOnce(d.ctx, leaseID); err == nil {
+			_, err := d.client.Put(d.ctx, workerKey(address), address, clientv3.WithLease(leaseID))
+			return err
+		}
+		// The lease likely already expired; fall through and grant a fresh one.
+	}
+
+	lease, err := d.client.Grant(d.ctx, int64(workerLeaseTTL.Seconds()))
+	if err != nil {
+		return fmt.Errorf("RegisterWorker: grant lease for %s: %v", address, err)
+	}
+
+	d.mu.Lock()
+	d.leases[address] = lease.ID
+	d.mu.Unlock()
+
+	_, err = d.client.Put(d.ctx, workerKey(address), address, clientv3.WithLease(lease.ID))
+	return err
+}
+
+func (d *EtcdDiscovery) Workers() ([]string, error) {
+	resp, err := d.client.Get(d.ctx, "mapreduce/workers/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	var addresses []string
+	for _, kv := range resp.Kvs {
+		addresses = append(addresses, string(kv.Value))
+	}
+	return addresses, nil
+}
+
+func (d *EtcdDiscovery) ClaimTask(kind TaskType, n int, worker string) error {
+	_, err := d.client.Put(d.ctx, taskKey(kind, n), worker)
+	return err
+}
+
+func (d *EtcdDiscovery) ReleaseTask(kind TaskType, n int) error {
+	_, err := d.client.Delete(d.ctx, taskKey(kind, n))
+	return err
+}
+
+func (d *EtcdDiscovery) TaskOwner(kind TaskType, n int) (string, bool, error) {
+	resp, err := d.client.Get(d.ctx, taskKey(kind, n))
+	if err != nil {
+		return "", false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", false, nil
+	}
+	return string(resp.Kvs[0].Value), true, nil
+}
+
+func (d *EtcdDiscovery) Close() error {
+	d.cancel()
+	return d.client.Close()
+}
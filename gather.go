@@ -0,0 +1,153 @@
+package main
+
+import (
+	"container/heap"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// rowIterator walks one source DB's pairs table in key order, one row
+// buffered ahead so callers can peek at the current key before consuming it.
+type rowIterator struct {
+	db      *sql.DB
+	rows    *sql.Rows
+	key     string
+	value   string
+	hasNext bool
+}
+
+func newRowIterator(path string) (*rowIterator, error) {
+	db, err := openDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query("select key, value from pairs order by key")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	it := &rowIterator{db: db, rows: rows}
+	if err := it.advance(); err != nil {
+		it.Close()
+		return nil, err
+	}
+	return it, nil
+}
+
+// advance loads the next row into key/value, or clears hasNext once the
+// underlying rows are exhausted.
+func (it *rowIterator) advance() error {
+	if !it.rows.Next() {
+		it.hasNext = false
+		return it.rows.Err()
+	}
+	it.hasNext = true
+	return it.rows.Scan(&it.key, &it.value)
+}
+
+func (it *rowIterator) Close() error {
+	it.rows.Close()
+	return it.db.Close()
+}
+
+// rowHeap is a min-heap of rowIterators ordered by their current key. It's
+// the k-way merge used by GatherOutputs to stitch R already-sorted reduce
+// outputs into one sorted stream without loading all of them into memory.
+type rowHeap []*rowIterator
+
+func (h rowHeap) Len() int           { return len(h) }
+func (h rowHeap) Less(i, j int) bool { return h[i].key < h[j].key }
+func (h rowHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *rowHeap) Push(x interface{}) {
+	*h = append(*h, x.(*rowIterator))
+}
+
+func (h *rowHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	*h = old[:n-1]
+	return it
+}
+
+// GatherOutputs HTTP-downloads reduce_R_output.db from each address in
+// reduceHosts (reduceHosts[r] is where reduce task r's output lives) and
+// k-way merges them, already sorted by key within each file, into a single
+// outputPath database written inside one transaction.
+func GatherOutputs(reduceHosts []string, outputPath string) error {
+	tmpdir, err := os.MkdirTemp("", "mapreduce-gather")
+	if err != nil {
+		return fmt.Errorf("GatherOutputs: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var sources rowHeap
+	defer func() {
+		for _, it := range sources {
+			it.Close()
+		}
+	}()
+
+	for r, host := range reduceHosts {
+		file := reduceOutputFile(r)
+		url := makeURL(host, file)
+		localPath := filepath.Join(tmpdir, file)
+		if err := download(url, localPath); err != nil {
+			return fmt.Errorf("GatherOutputs: downloading %s: %v", url, err)
+		}
+
+		it, err := newRowIterator(localPath)
+		if err != nil {
+			return fmt.Errorf("GatherOutputs: opening %s: %v", localPath, err)
+		}
+		if it.hasNext {
+			sources = append(sources, it)
+		} else {
+			it.Close()
+		}
+	}
+
+	heap.Init(&sources)
+
+	out, err := createDatabase(outputPath)
+	if err != nil {
+		return fmt.Errorf("GatherOutputs: creating %s: %v", outputPath, err)
+	}
+	defer out.Close()
+
+	tx, err := out.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare("INSERT INTO pairs (key, value) VALUES (?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for sources.Len() > 0 {
+		next := sources[0]
+		if _, err := stmt.Exec(next.key, next.value); err != nil {
+			stmt.Close()
+			tx.Rollback()
+			return err
+		}
+		if err := next.advance(); err != nil {
+			stmt.Close()
+			tx.Rollback()
+			return err
+		}
+		if next.hasNext {
+			heap.Fix(&sources, 0)
+		} else {
+			heap.Pop(&sources)
+			next.Close()
+		}
+	}
+
+	stmt.Close()
+	return tx.Commit()
+}
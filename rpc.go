@@ -0,0 +1,50 @@
+package main
+
+// TaskType identifies what kind of work (if any) a RequestTask reply is
+// handing back to a worker.
+type TaskType int
+
+const (
+	TaskNone   TaskType = iota // nothing to do yet, come back later
+	TaskMap                    // reply.MapTask is valid
+	TaskReduce                 // reply.ReduceTask is valid
+	TaskWait                   // all remaining tasks are in flight, poll again
+	TaskExit                   // job is done, worker should shut down
+)
+
+// TaskArgs is sent by a worker asking the coordinator for work.
+type TaskArgs struct {
+	WorkerAddress string // host:port the worker's own /data/ server is listening on
+}
+
+// TaskReply is the coordinator's answer to RequestTask.
+type TaskReply struct {
+	Type       TaskType
+	MapTask    *MapTask
+	ReduceTask *ReduceTask
+	TmpDir     string // directory the worker should use for intermediate files
+}
+
+// TaskDoneArgs reports that a worker finished the task it was handed. The
+// Pairs/Bytes/Elapsed fields are metrics piggybacked on the RPC so the
+// coordinator's Progress can stay up to date without any extra round trip.
+type TaskDoneArgs struct {
+	Type          TaskType
+	N             int    // which map/reduce task number finished
+	WorkerAddress string // where the task's output can be fetched via /data/
+
+	PairsIn, PairsOut int
+	BytesOut          int64
+	ElapsedMs         int64
+}
+
+type TaskDoneReply struct{}
+
+// HeartbeatArgs is sent by a worker that's still busy processing a task, so
+// its registration doesn't lapse after workerLeaseTTL while it's
+// legitimately working and not merely dead.
+type HeartbeatArgs struct {
+	WorkerAddress string
+}
+
+type HeartbeatReply struct{}
@@ -7,10 +7,12 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/rpc"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 )
 
@@ -18,12 +20,22 @@ type MapTask struct {
 	M, R       int    // total number of map and reduce tasks
 	N          int    // map task number, 0-based
 	SourceHost string // address of host with map input file
+
+	// PairsIn/PairsOut/BytesOut are filled in by Process as it runs, and
+	// piggybacked on the worker's TaskDone RPC as job metrics.
+	PairsIn, PairsOut int
+	BytesOut          int64
 }
 
 type ReduceTask struct {
 	M, R        int      // total number of map and reduce tasks
 	N           int      // reduce task number, 0-based
 	SourceHosts []string // addresses of map workers
+
+	// PairsIn/PairsOut/BytesOut are filled in by Process as it runs, and
+	// piggybacked on the worker's TaskDone RPC as job metrics.
+	PairsIn, PairsOut int
+	BytesOut          int64
 }
 
 type Pair struct {
@@ -36,6 +48,21 @@ type Interface interface {
 	Reduce(key string, values <-chan string, output chan<- Pair) error
 }
 
+// Combiner is an optional extension to Interface. Clients that implement it
+// get their map output pre-reduced per key before it ever hits a per-partition
+// SQL insert, which matters a lot for jobs (like word count) that emit one row
+// per occurrence instead of one row per key. MapTask.Process detects it with a
+// type assertion so existing clients that only implement Interface still
+// compile and run unchanged.
+type Combiner interface {
+	Combine(key string, values <-chan string, output chan<- Pair) error
+}
+
+// combineByteThreshold is the amount of buffered key/value data (in bytes)
+// MapTask.Process accumulates before running the client's Combiner over the
+// buffer and flushing the combined pairs to disk.
+const combineByteThreshold = 1 << 20 // 1 MiB
+
 type Client struct{}
 
 const (
@@ -130,6 +157,13 @@ func (c Client) Reduce(key string, values <-chan string, output chan<- Pair) err
 	return nil
 }
 
+// Combine is identical to Reduce: summing partial word counts before they
+// leave the map worker is exactly the same operation as summing them during
+// reduce, it just happens on a smaller, per-map-task slice of the data.
+func (c Client) Combine(key string, values <-chan string, output chan<- Pair) error {
+	return c.Reduce(key, values, output)
+}
+
 func createPaths(amount int, typeOfFile int, tmp string) []string {
 	i := 0
 	var paths []string
@@ -175,32 +209,132 @@ func InsertPair(task *MapTask, path string, pair Pair) error {
 	outputDB := mapOutputFile(n, r)
 	db, err := getDatabase(filepath.Join(path, outputDB))
 	if err != nil {
-		db.Close()
-		log.Fatalf("InsertPair: getDatabase: %v", err)
-		return err
+		return fmt.Errorf("InsertPair: getDatabase: %v", err)
 	}
 
 	// insert pairs into the output DB
 	_, err = db.Exec("INSERT INTO pairs (key, value) VALUES (?, ?)", pair.Key, pair.Value)
 	if err != nil {
 		db.Close()
-		log.Fatalf("InsertPair: error inserting pairs into database: %v", err)
-		return err
+		return fmt.Errorf("InsertPair: error inserting pairs into database: %v", err)
 	}
 	db.Close()
 
 	return nil
 }
 
+// insertPairsBatch groups pairs by reduce partition and writes each
+// partition's output DB in a single transaction, instead of the one-INSERT-
+// per-pair pattern InsertPair uses.
+func insertPairsBatch(task *MapTask, path string, pairs []Pair) error {
+	byPartition := make(map[int][]Pair)
+	for _, p := range pairs {
+		hash := fnv.New32()
+		hash.Write([]byte(p.Key))
+		r := int(hash.Sum32() % uint32(task.R))
+		byPartition[r] = append(byPartition[r], p)
+	}
+
+	for r, ps := range byPartition {
+		outputDB := mapOutputFile(task.N, r)
+		db, err := getDatabase(filepath.Join(path, outputDB))
+		if err != nil {
+			return err
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			db.Close()
+			return err
+		}
+		stmt, err := tx.Prepare("INSERT INTO pairs (key, value) VALUES (?, ?)")
+		if err != nil {
+			tx.Rollback()
+			db.Close()
+			return err
+		}
+		for _, p := range ps {
+			if _, err := stmt.Exec(p.Key, p.Value); err != nil {
+				stmt.Close()
+				tx.Rollback()
+				db.Close()
+				return err
+			}
+		}
+		stmt.Close()
+		if err := tx.Commit(); err != nil {
+			db.Close()
+			return err
+		}
+		db.Close()
+	}
+	return nil
+}
+
+// flushCombinedBuffer runs combiner.Combine over every key currently
+// buffered and batch-inserts the combined results. The caller is
+// responsible for clearing buf once this returns.
+func flushCombinedBuffer(task *MapTask, path string, combiner Combiner, buf map[string][]string) error {
+	var combined []Pair
+	for key, values := range buf {
+		valuesCh := make(chan string, len(values))
+		for _, v := range values {
+			valuesCh <- v
+		}
+		close(valuesCh)
+
+		output := make(chan Pair)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for p := range output {
+				combined = append(combined, p)
+			}
+		}()
+
+		err := combiner.Combine(key, valuesCh, output)
+		<-done
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := insertPairsBatch(task, path, combined); err != nil {
+		return err
+	}
+	task.PairsOut += len(combined)
+	for _, p := range combined {
+		task.BytesOut += int64(len(p.Key) + len(p.Value))
+	}
+	return nil
+}
+
+// removeMapOutputs deletes any output this map task number may have left
+// behind from an earlier attempt, so a retry (same worker, same tmpdir)
+// starts from empty partition files instead of appending onto stale rows.
+func removeMapOutputs(task *MapTask, path string) error {
+	for r := 0; r < task.R; r++ {
+		p := filepath.Join(path, mapOutputFile(task.N, r))
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removeMapOutputs: removing %s: %v", p, err)
+		}
+	}
+	return nil
+}
+
 func (task *MapTask) Process(path string, client Interface) error {
+	if err := removeMapOutputs(task, path); err != nil {
+		return err
+	}
+
 	// make URL
 	file := mapSourceFile(task.N)
 	url := makeURL(task.SourceHost, file)
-	mapFile := mapInputFile(task.N)
+	mapFile := filepath.Join(path, mapInputFile(task.N))
 
 	err := download(url, mapFile)
 	if err != nil {
-		log.Printf("MapTask.Process: error in downloading path %s: %v", path, err)
+		return fmt.Errorf("MapTask.Process: downloading %s to %s: %v", url, mapFile, err)
 	}
 
 	var db *sql.DB
@@ -217,312 +351,361 @@ func (task *MapTask) Process(path string, client Interface) error {
 		log.Printf("error in select query from database to get pairs: %v", err)
 		return err
 	}
+	defer rows.Close()
 
-	// map process
-	// ... spin up goroutine
-	go func() {
-		defer rows.Close()
-		// for key, value from input
-		var key string
-		var value string
-
-		for rows.Next() {
-			if err = rows.Scan(&key, &value); err != nil {
-				log.Fatalf("MapTask.Process: error scanning rows: %v", err)
-			}
+	combiner, hasCombiner := client.(Combiner)
+	buf := make(map[string][]string)
+	bufBytes := 0
 
-			// call map
-			output := make(chan Pair)
+	// map process, one key/value row at a time. Process blocks until every
+	// row has been mapped so the caller can report TaskDone as soon as it
+	// returns.
+	var key string
+	var value string
 
-			// output
-			go func() {
-				for pair := range output {
-					err = InsertPair(task, path, pair)
-					if err != nil {
-						log.Printf("MapTask.Process: InsertPair: %v", err)
-					}
+	for rows.Next() {
+		if err = rows.Scan(&key, &value); err != nil {
+			return err
+		}
+		task.PairsIn++
+
+		output := make(chan Pair)
+		insertErrCh := make(chan error, 1)
+
+		go func() {
+			var insertErr error
+			for pair := range output {
+				if hasCombiner {
+					buf[pair.Key] = append(buf[pair.Key], pair.Value)
+					bufBytes += len(pair.Key) + len(pair.Value)
+					continue
 				}
-			}()
-
-			err = client.Map(key, value, output)
-			if err != nil {
-				log.Printf("Client.Map: %v", err)
+				if err := InsertPair(task, path, pair); err != nil {
+					insertErr = err
+					continue
+				}
+				task.PairsOut++
+				task.BytesOut += int64(len(pair.Key) + len(pair.Value))
 			}
+			insertErrCh <- insertErr
+		}()
 
-			task.M++
+		if err = client.Map(key, value, output); err != nil {
+			<-insertErrCh
+			return err
+		}
+		if err = <-insertErrCh; err != nil {
+			return err
 		}
-	}()
 
-	return err
+		if hasCombiner && bufBytes >= combineByteThreshold {
+			if err := flushCombinedBuffer(task, path, combiner, buf); err != nil {
+				return err
+			}
+			buf = make(map[string][]string)
+			bufBytes = 0
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if hasCombiner && len(buf) > 0 {
+		return flushCombinedBuffer(task, path, combiner, buf)
+	}
+	return nil
 }
 
 //Process for ReduceTask
 
 func (task *ReduceTask) Process(path string, client Interface) error {
-//func (task *ReduceTask) Process(path string, client Interface, rfile string) error {
-	var reduce_temp_files []string
-	//fmt.Println(task.M, task.R)
-	m := 0
-	for m < task.M {
+	var mapOutputURLs []string
+	for m := 0; m < task.M; m++ {
 		file := mapOutputFile(m, task.N)
-		url := makeURL(task.SourceHosts[m], file)
-		reduce_temp_files = append(reduce_temp_files, url)
-		m++
+		mapOutputURLs = append(mapOutputURLs, makeURL(task.SourceHosts[m], file))
 	}
 
-	db, err := mergeDatabases(reduce_temp_files, reduceInputFile(task.N), reduceTempFile(task.N))
+	mergedDB, err := mergeDatabases(mapOutputURLs, filepath.Join(path, reduceInputFile(task.N)), filepath.Join(path, reduceTempFile(task.N)))
 	if err != nil {
-		log.Fatalf("No, merge did not work for some reason %v", err)
-		return err
+		return fmt.Errorf("ReduceTask.Process: merging map outputs: %v", err)
 	}
+	defer mergedDB.Close()
 
-	db.Close()
-	return nil
-
-	// everything works above
-	
-	/*var urls []string
-	m := task.M
-
-	i := 0
-	for i < m {
-		file := mapOutputFile(i, task.N)
-		url := makeURL(getLocalAddress()+":8080", file)
-		urls = append(urls, url)
-		i++
+	rows, err := mergedDB.Query("select key, value from pairs order by key")
+	if err != nil {
+		return fmt.Errorf("ReduceTask.Process: querying merged pairs: %v", err)
 	}
+	defer rows.Close()
 
-	temp := createPaths(1, reduceTemp, path)
-
-	source := "austen.db"
-
-	if err := splitDatabase(source, temp); err != nil {
-		log.Fatalf("splitting database: %v", err)
+	outputDB, err := createDatabase(filepath.Join(path, reduceOutputFile(task.N)))
+	if err != nil {
+		return fmt.Errorf("ReduceTask.Process: creating output db: %v", err)
 	}
+	defer outputDB.Close()
 
-	//file := reduceInputFile(task.N)
-
-	fmt.Println(temp[0], "\n\n\n\n\n")
-
-	//for i := 0; i < len(temp);i++
-
-	//new_path := filepath.Join(path, rfile)
-
-	fmt.Println(path)
-	db, err := mergeDatabases(urls, rfile, temp[0])
-
+	tx, err := outputDB.Begin()
 	if err != nil {
-		log.Fatalf("No, merge did not work for some reason ", err)
 		return err
-
-	} else {
-		log.Print("It worked!")
 	}
-	rows, _ := db.Query("select key, value from pairs order by key, value")
-
-	defer rows.Close()
-
-	// for key, value from input
-	var key string
-	var value string
-
-	var keys []string
-	var values <-chan string
-
-	i = 0
+	stmt, err := tx.Prepare("INSERT INTO pairs (key, value) VALUES (?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
 
-	go func() error {
+	var key, value string
+	hasRow := rows.Next()
+	if hasRow {
+		if err := rows.Scan(&key, &value); err != nil {
+			stmt.Close()
+			tx.Rollback()
+			return err
+		}
+	}
 
-		for rows.Next() {
-			if err := rows.Scan(&key, &value); err != nil {
-				return err
+	// Group consecutive rows (the query is sorted by key) and hand each
+	// group's values to client.Reduce over a channel, draining its output
+	// into reduce_N_output.db as it arrives.
+	for hasRow {
+		groupKey := key
+
+		values := make(chan string)
+		output := make(chan Pair)
+
+		reduceErrCh := make(chan error, 1)
+		go func() {
+			reduceErrCh <- client.Reduce(groupKey, values, output)
+		}()
+
+		insertErrCh := make(chan error, 1)
+		go func() {
+			var insertErr error
+			for p := range output {
+				if _, err := stmt.Exec(p.Key, p.Value); err != nil {
+					insertErr = err
+					continue
+				}
+				task.PairsOut++
+				task.BytesOut += int64(len(p.Key) + len(p.Value))
 			}
-
-			//fmt.Println("Ran")
-
-			output := make(chan Pair)
-
-			err = client.Reduce(key, values, output)
-
-			keys = append(keys, key)
-			if i != 0 {
-				if keys[i-1] != key {
-					output <- Pair{key, value}
+			insertErrCh <- insertErr
+		}()
+
+		for hasRow && key == groupKey {
+			values <- value
+			task.PairsIn++
+			hasRow = rows.Next()
+			if hasRow {
+				if err := rows.Scan(&key, &value); err != nil {
+					close(values)
+					<-reduceErrCh
+					<-insertErrCh
+					stmt.Close()
+					tx.Rollback()
+					return err
 				}
 			}
-			i++
 		}
+		close(values) // previous group's channel must close before the next group starts
 
+		if err := <-reduceErrCh; err != nil {
+			<-insertErrCh
+			stmt.Close()
+			tx.Rollback()
+			return err
+		}
+		if err := <-insertErrCh; err != nil {
+			stmt.Close()
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		stmt.Close()
+		tx.Rollback()
 		return err
-	}()
-
-	return err
-	*/
-	//TODO: Need to process all pairs in correct order
+	}
 
+	stmt.Close()
+	return tx.Commit()
 }
 
-func main() {
+// RunWorker starts a worker process that talks to the coordinator at
+// coordinatorAddress. It serves its own /data/ directory over HTTP so the
+// coordinator and other workers can fetch its task output, then loops
+// requesting and processing tasks until the coordinator says the job is
+// done.
+func RunWorker(coordinatorAddress string) error {
+	the_address := net.JoinHostPort(getLocalAddress(), "0")
 
-	// Introduction
-	log.Print("Map Reduce -- Part 1")
-	log.Print("By: Jordan Coleman & Hailey Whipple")
-
-	//path := "source.db"
-	source := "austen.db"
-
-	number_of_rows, _ := getNumberOfRows(source)
-	page_count, _, _ := getDatabaseSize(source)
-
-	var m int = number_of_rows / page_count
-	var r int = m / 2
-
-	//m := 11
-	//r := 5
-
-	//source := "austin.db"
-
-	tmp := os.TempDir()
-
-	tempdir := filepath.Join(tmp, fmt.Sprintf("mapreduce.%d", os.Getpid()))
-
-	//fmt.Println("Temp Dir ", tempdir)
+	listener, err := net.Listen("tcp", the_address)
+	if err != nil {
+		return fmt.Errorf("RunWorker: listen: %v", err)
+	}
+	the_address = listener.Addr().String()
 
+	tempdir := filepath.Join(os.TempDir(), fmt.Sprintf("mapreduce-worker.%d", os.Getpid()))
 	if err := os.RemoveAll(tempdir); err != nil {
-		log.Fatalf("unable to delete old temp dir: %v", err)
+		return fmt.Errorf("RunWorker: unable to delete old temp dir: %v", err)
 	}
 	if err := os.Mkdir(tempdir, 0700); err != nil {
-		log.Fatalf("Was unable to make a temp dir")
+		return fmt.Errorf("RunWorker: unable to make temp dir: %v", err)
 	}
 	defer os.RemoveAll(tempdir)
 
-	log.Printf("splitting %s into %d pieces", source, m)
+	mux := http.NewServeMux()
+	mux.Handle("/data/", http.StripPrefix("/data", http.FileServer(http.Dir(tempdir))))
+	go http.Serve(listener, mux)
 
-	var paths []string
-
-	paths = createPaths(m, mapSource, tempdir)
-
-	//for i := 0; i < m; i++ {
+	log.Printf("worker %s starting, coordinator is %s", the_address, coordinatorAddress)
 
-	//paths = createPaths(m, mapSource, tempdir)
-	//paths_map_input := createPaths(m, mapInput, tempdir)
-	//paths_map_output := createPaths(m, mapOutput, tempdir)
-	//paths_reduce_input := createPaths(m, reduceInput, tempdir)
-
-	//fmt.Println("\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n", paths3, "\n\n\n\n\n\n\n\n\n\n\n\n\n\n")
-	//}
+	var client Client
 
-	/*
-		for i := 0; i < m; i++ {
-			paths = append(paths, filepath.Join(tempdir, mapSourceFile(i)))
+	for {
+		client_rpc, err := rpc.DialHTTP("tcp", coordinatorAddress)
+		if err != nil {
+			return fmt.Errorf("RunWorker: dialing coordinator: %v", err)
 		}
-	*/
 
-	if err := splitDatabase(source, paths); err != nil {
-		log.Fatalf("splitting database: %v", err)
-	}
+		args := TaskArgs{WorkerAddress: the_address}
+		var reply TaskReply
+		err = client_rpc.Call("Coordinator.RequestTask", &args, &reply)
+		client_rpc.Close()
+		if err != nil {
+			return fmt.Errorf("RunWorker: RequestTask: %v", err)
+		}
 
-	/*
-	if err := splitDatabase(source, paths_map_input); err != nil {
-		log.Fatalf("splitting database: %v", err)
-	}
-	if err := splitDatabase(source, paths_map_output); err != nil {
-		log.Fatalf("splitting database: %v", err)
+		switch reply.Type {
+		case TaskMap:
+			log.Printf("worker %s: running map task %d", the_address, reply.MapTask.N)
+			started := time.Now()
+			stopHeartbeat := startHeartbeat(coordinatorAddress, the_address)
+			err := reply.MapTask.Process(tempdir, client)
+			stopHeartbeat()
+			if err != nil {
+				log.Printf("worker %s: map task %d failed: %v", the_address, reply.MapTask.N, err)
+				continue
+			}
+			task := reply.MapTask
+			if err := reportTaskDone(coordinatorAddress, TaskMap, task.N, the_address, task.PairsIn, task.PairsOut, task.BytesOut, time.Since(started)); err != nil {
+				log.Printf("worker %s: TaskDone: %v", the_address, err)
+			}
+		case TaskReduce:
+			log.Printf("worker %s: running reduce task %d", the_address, reply.ReduceTask.N)
+			started := time.Now()
+			stopHeartbeat := startHeartbeat(coordinatorAddress, the_address)
+			err := reply.ReduceTask.Process(tempdir, client)
+			stopHeartbeat()
+			if err != nil {
+				log.Printf("worker %s: reduce task %d failed: %v", the_address, reply.ReduceTask.N, err)
+				continue
+			}
+			task := reply.ReduceTask
+			if err := reportTaskDone(coordinatorAddress, TaskReduce, task.N, the_address, task.PairsIn, task.PairsOut, task.BytesOut, time.Since(started)); err != nil {
+				log.Printf("worker %s: TaskDone: %v", the_address, err)
+			}
+		case TaskWait:
+			time.Sleep(time.Second)
+		case TaskExit:
+			log.Printf("worker %s: job done, exiting", the_address)
+			return nil
+		}
 	}
-	if err := splitDatabase(source, paths_reduce_input); err != nil {
-		log.Fatalf("splitting database: %v", err)
-	}*/
-
-	the_address := net.JoinHostPort(getLocalAddress(), "8080")
-	log.Print("Here is a new address that we are starting an http server with and it is ", the_address)
-
-	http.Handle("/data/", http.StripPrefix("/data", http.FileServer(http.Dir(tempdir))))
-
-	listener, err := net.Listen("tcp", the_address)
+}
 
-	if err != nil {
-		log.Fatalf("There was a listen error. Here are some things to consider: ", listener, err)
-	}
+// heartbeatInterval is how often a worker renews its registration while a
+// task is in progress. It must be well under workerLeaseTTL so a single
+// missed beat doesn't make a genuinely busy worker look dead.
+const heartbeatInterval = workerLeaseTTL / 3
+
+// startHeartbeat renews the worker's registration on a ticker for as long as
+// a task is being processed, so a task that legitimately runs longer than
+// workerLeaseTTL doesn't get the worker mistaken for dead and its task
+// reassigned out from under it. The returned func stops the heartbeat and
+// must be called once the task finishes.
+func startHeartbeat(coordinatorAddress, workerAddress string) (stop func()) {
+	done := make(chan struct{})
 	go func() {
-		if err := http.Serve(listener, nil); err != nil {
-			log.Fatalf("There was an error with Serve for some reason")
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := sendHeartbeat(coordinatorAddress, workerAddress); err != nil {
+					log.Printf("worker %s: Heartbeat: %v", workerAddress, err)
+				}
+			case <-done:
+				return
+			}
 		}
-
 	}()
+	return func() { close(done) }
+}
 
-	var mapTasks []*MapTask
+func sendHeartbeat(coordinatorAddress, workerAddress string) error {
+	client_rpc, err := rpc.DialHTTP("tcp", coordinatorAddress)
+	if err != nil {
+		return err
+	}
+	defer client_rpc.Close()
 
-	//defer os.RemoveAll(tempdir)
+	args := HeartbeatArgs{WorkerAddress: workerAddress}
+	var reply HeartbeatReply
+	return client_rpc.Call("Coordinator.Heartbeat", &args, &reply)
+}
 
-	// This is where we are building our map tasks
-	for i := 0; i < m; i++ {
-		task := &MapTask{
-			M:          m,
-			R:          r,
-			N:          i,
-			SourceHost: the_address,
-		}
-		mapTasks = append(mapTasks, task)
+func reportTaskDone(coordinatorAddress string, taskType TaskType, n int, workerAddress string, pairsIn, pairsOut int, bytesOut int64, elapsed time.Duration) error {
+	client_rpc, err := rpc.DialHTTP("tcp", coordinatorAddress)
+	if err != nil {
+		return err
 	}
+	defer client_rpc.Close()
+
+	args := TaskDoneArgs{
+		Type:          taskType,
+		N:             n,
+		WorkerAddress: workerAddress,
+		PairsIn:       pairsIn,
+		PairsOut:      pairsOut,
+		BytesOut:      bytesOut,
+		ElapsedMs:     elapsed.Milliseconds(),
+	}
+	var reply TaskDoneReply
+	return client_rpc.Call("Coordinator.TaskDone", &args, &reply)
+}
 
-	// This is where we are building our reduce tasks
-
-	var reduceTasks []*ReduceTask
+func main() {
+	log.Print("Map Reduce -- Part 1")
+	log.Print("By: Jordan Coleman & Hailey Whipple")
 
-	for i := 0; i < r; i++ {
-		task := &ReduceTask{
-			M:           m,
-			R:           r,
-			N:           i,
-			SourceHosts: make([]string, m),
-		}
-		reduceTasks = append(reduceTasks, task)
+	if len(os.Args) < 2 {
+		log.Fatalf("usage: %s coordinator <source.db> [backend] [endpoint] | %s worker <coordinator-address>", os.Args[0], os.Args[0])
 	}
 
-	var client Client
-
-	// This is where we are processing the map tasks
-	for i, task := range mapTasks {
-		if err := task.Process(tempdir, client); err != nil {
-			log.Fatalf("there was an error with processing the maptask: ", i, err)
+	switch os.Args[1] {
+	case "coordinator":
+		if len(os.Args) < 3 {
+			log.Fatalf("usage: %s coordinator <source.db> [local|etcd|consul] [endpoint]", os.Args[0])
 		}
-		for _, reduce := range reduceTasks {
-			reduce.SourceHosts[i] = the_address //Question: Why are we passing in the same address here everytime?
+		var backendKind, backendEndpoint string
+		if len(os.Args) > 3 {
+			backendKind = os.Args[3]
 		}
-	}
-
-	fmt.Println(tmp)
-	fmt.Println(tempdir)
-	fmt.Println("processed all of map tasks")
-
-	//This is where we are processing the reduce tasks
-
-	//fmt.Println("\n\n\n\n\n\n\n\n\n", len(reduceTasks), "\n\n\n\n\n\n")
-
-	for i, task := range reduceTasks {
-		//r_path := filepath.Join(tempdir, paths_reduce_input[i])
-		if err := task.Process(tempdir, client); err != nil {
-		//if err := task.Process(tempdir, client, paths_reduce_input[i]); err != nil { //
-			log.Fatalf("there was an error with processing the reduce task: ", i, err)
+		if len(os.Args) > 4 {
+			backendEndpoint = os.Args[4]
 		}
-	}
-
-	/* NEXT STEP IS WE NEED TO GATHER OUTPUTS INTO FINAL target.db FILE
-
-	//This is what we wrote last time
-
-	//client := new(Interface)
-	//shell(client)
-
-	*/
-
-	go func() {
-		http.Handle("/data/", http.StripPrefix("/data", http.FileServer(http.Dir(tempdir))))
-		if err := http.ListenAndServe(the_address, nil); err != nil {
-			log.Printf("Error in HTTP server for %s: %v", the_address, err)
+		runCoordinatorMain(os.Args[2], backendKind, backendEndpoint)
+	case "worker":
+		if len(os.Args) < 3 {
+			log.Fatalf("usage: %s worker <coordinator-address>", os.Args[0])
 		}
-	}()
-
+		if err := RunWorker(os.Args[2]); err != nil {
+			log.Fatalf("worker: %v", err)
+		}
+	default:
+		log.Fatalf("usage: %s coordinator <source.db> | %s worker <coordinator-address>", os.Args[0], os.Args[0])
+	}
 }
 
-// go run *.go
+// go run . coordinator austen.db
+// go run . worker <coordinator-host:port>
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// noCombineClient implements Interface but deliberately not Combiner, so
+// BenchmarkMapTaskProcess can measure MapTask.Process without the combiner
+// fast path.
+type noCombineClient struct{}
+
+func (noCombineClient) Map(key, value string, output chan<- Pair) error {
+	return Client{}.Map(key, value, output)
+}
+
+func (noCombineClient) Reduce(key string, values <-chan string, output chan<- Pair) error {
+	return Client{}.Reduce(key, values, output)
+}
+
+// BenchmarkMapTaskProcess compares combiner-on vs combiner-off map output on
+// austen.db, which is mostly duplicate words and so is exactly the case the
+// combiner is meant to help: word count ends up with one row per word per
+// combiner flush (one flush per combineByteThreshold of buffered output)
+// instead of one row per occurrence.
+func BenchmarkMapTaskProcess(b *testing.B) {
+	source := "austen.db"
+	if _, err := os.Stat(source); err != nil {
+		b.Skipf("austen.db not present: %v", err)
+	}
+
+	sourceAbs, err := filepath.Abs(source)
+	if err != nil {
+		b.Fatalf("abs: %v", err)
+	}
+
+	run := func(b *testing.B, client Interface) {
+		for i := 0; i < b.N; i++ {
+			tmpdir := b.TempDir()
+
+			// MapTask.Process downloads its input over HTTP from
+			// task.SourceHost, so set it up the same way the coordinator
+			// does: split austen.db into the shard Process expects, and
+			// serve it from a /data/ file server like a real worker would.
+			sourceDir := b.TempDir()
+			paths := createPaths(1, mapSource, sourceDir)
+			if err := splitDatabase(sourceAbs, paths); err != nil {
+				b.Fatalf("splitDatabase: %v", err)
+			}
+
+			srv := httptest.NewServer(http.StripPrefix("/data", http.FileServer(http.Dir(sourceDir))))
+			defer srv.Close()
+
+			task := &MapTask{M: 1, R: 8, N: 0, SourceHost: strings.TrimPrefix(srv.URL, "http://")}
+
+			if err := task.Process(tmpdir, client); err != nil {
+				b.Fatalf("MapTask.Process: %v", err)
+			}
+		}
+	}
+
+	b.Run("CombinerOff", func(b *testing.B) { run(b, noCombineClient{}) })
+	b.Run("CombinerOn", func(b *testing.B) { run(b, Client{}) })
+}